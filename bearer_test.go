@@ -0,0 +1,85 @@
+package jwtauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lestrrat/go-jwx/jwt"
+)
+
+func TestIssueBearerAndDecode(t *testing.T) {
+	cs := jwt.NewClaimSet()
+	for k, v := range testData {
+		if err := cs.Set(k, v); err != nil {
+			t.Fatalf("Error setting %s value: %s", k, err)
+		}
+	}
+	token, err := auth.IssueBearer(cs)
+	if err != nil {
+		t.Fatalf("IssueBearer failed: %s", err)
+	}
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Unable to create http request: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	ncs, err := auth.decodeToken(req)
+	if err != nil {
+		t.Fatalf("Bearer token decode failed: %s", err)
+	}
+	verifyClaimSet(t, ncs)
+}
+
+func TestBearerAuthenticateRejectsMissingToken(t *testing.T) {
+	ts := httptest.NewServer(auth.BearerAuthenticate(recordingHandler))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected %d got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	if resp.Header.Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("expected WWW-Authenticate: Bearer header, got %q", resp.Header.Get("WWW-Authenticate"))
+	}
+}
+
+func TestBearerAuthenticateAcceptsValidToken(t *testing.T) {
+	cs := jwt.NewClaimSet()
+	for k, v := range testData {
+		if err := cs.Set(k, v); err != nil {
+			t.Fatalf("Error setting %s value: %s", k, err)
+		}
+	}
+	token, err := auth.IssueBearer(cs)
+	if err != nil {
+		t.Fatalf("IssueBearer failed: %s", err)
+	}
+
+	ts := httptest.NewServer(auth.BearerAuthenticate(recordingHandler))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d got %d", http.StatusOK, resp.StatusCode)
+	}
+	if !recordingHandler.Called {
+		t.Error("BearerAuthenticate didn't pass through to next handler")
+	}
+}
@@ -0,0 +1,78 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+const (
+	csrfClaim      = "csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfTokenBytes = 32
+)
+
+// safeMethods are the HTTP methods CSRFProtect treats as read-only and
+// therefore exempt from the token check.
+var safeMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"TRACE":   true,
+}
+
+// newCSRFToken returns a fresh random token suitable for the csrf claim.
+func newCSRFToken() (string, error) {
+	b := make([]byte, csrfTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CSRFProtect implements double-submit CSRF protection using the token
+// EncodeToken stamps into every JWT's "csrf" claim (so it's rotated
+// automatically on login and on every TokenHeartbeat refresh). It must run
+// downstream of TokenAuthenticate or TokenHeartbeat so a claim set is
+// already in the request context.
+//
+// Safe methods (GET, HEAD, OPTIONS, TRACE) pass through unchecked. Unsafe
+// methods must echo the claim's token back in the X-CSRF-Token header; a
+// missing, mismatched, or unauthenticated request is rejected with 403.
+func (auth *Authenticator) CSRFProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if safeMethods[r.Method] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cs, ok := auth.ClaimSetFromRequest(r)
+		if !ok {
+			http.Error(w, "no authenticated session", http.StatusForbidden)
+			return
+		}
+		claimed, _ := cs.Get(csrfClaim).(string)
+		header := r.Header.Get(csrfHeaderName)
+		if claimed == "" || header == "" || subtle.ConstantTimeCompare([]byte(claimed), []byte(header)) != 1 {
+			http.Error(w, "CSRF token mismatch", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeCSRFToken writes the caller's current CSRF token as the response
+// body so client-side JS, which cannot read the HttpOnly JWT cookie, can
+// fetch the value to echo back in X-CSRF-Token. It must run downstream of
+// TokenAuthenticate or TokenHeartbeat.
+func (auth *Authenticator) ServeCSRFToken(w http.ResponseWriter, r *http.Request) {
+	cs, ok := auth.ClaimSetFromRequest(r)
+	if !ok {
+		http.Error(w, "no authenticated session", http.StatusForbidden)
+		return
+	}
+	token, _ := cs.Get(csrfClaim).(string)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(token))
+}
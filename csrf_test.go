@@ -0,0 +1,151 @@
+package jwtauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func csrfTokenFor(t *testing.T, a *Authenticator, ctok *http.Cookie) string {
+	t.Helper()
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Unable to create http request: %s", err)
+	}
+	req.AddCookie(ctok)
+	cs, err := a.decodeToken(req)
+	if err != nil {
+		t.Fatalf("Token decode failed: %s", err)
+	}
+	token, _ := cs.Get(csrfClaim).(string)
+	if token == "" {
+		t.Fatal("issued token carries no csrf claim")
+	}
+	return token
+}
+
+func doCSRFRequest(ts *httptest.Server, method string, ctok *http.Cookie, header string) (*http.Response, error) {
+	req, err := http.NewRequest(method, ts.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.AddCookie(ctok)
+	if header != "" {
+		req.Header.Set(csrfHeaderName, header)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func TestCSRFProtectAllowsSafeMethodWithoutHeader(t *testing.T) {
+	ts := httptest.NewServer(auth.TokenAuthenticate(auth.CSRFProtect(recordingHandler)))
+	defer ts.Close()
+
+	ctok, err := getTestCookie(t, auth)
+	if err != nil {
+		t.Fatalf("Error getting a test cookie: %s", err)
+	}
+
+	resp, err := getWithCookie(ts, ctok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET with no CSRF header should pass through, got %d", resp.StatusCode)
+	}
+}
+
+func TestCSRFProtectRejectsUnsafeMethodWithoutHeader(t *testing.T) {
+	ts := httptest.NewServer(auth.TokenAuthenticate(auth.CSRFProtect(recordingHandler)))
+	defer ts.Close()
+
+	ctok, err := getTestCookie(t, auth)
+	if err != nil {
+		t.Fatalf("Error getting a test cookie: %s", err)
+	}
+	resp, err := doCSRFRequest(ts, "POST", ctok, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST with no CSRF header should be rejected, expected %d got %d",
+			http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestCSRFProtectRejectsMismatchedHeader(t *testing.T) {
+	ts := httptest.NewServer(auth.TokenAuthenticate(auth.CSRFProtect(recordingHandler)))
+	defer ts.Close()
+
+	ctok, err := getTestCookie(t, auth)
+	if err != nil {
+		t.Fatalf("Error getting a test cookie: %s", err)
+	}
+	resp, err := doCSRFRequest(ts, "POST", ctok, corrupt(csrfTokenFor(t, auth, ctok)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST with mismatched CSRF header should be rejected, expected %d got %d",
+			http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestCSRFProtectAllowsMatchingHeader(t *testing.T) {
+	ts := httptest.NewServer(auth.TokenAuthenticate(auth.CSRFProtect(recordingHandler)))
+	defer ts.Close()
+
+	ctok, err := getTestCookie(t, auth)
+	if err != nil {
+		t.Fatalf("Error getting a test cookie: %s", err)
+	}
+	resp, err := doCSRFRequest(ts, "POST", ctok, csrfTokenFor(t, auth, ctok))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST with matching CSRF header should pass through, expected %d got %d",
+			http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestCSRFTokenRotatesOnHeartbeat(t *testing.T) {
+	ctok, err := getTestCookie(t, auth)
+	if err != nil {
+		t.Fatalf("Error getting a test cookie: %s", err)
+	}
+	firstToken := csrfTokenFor(t, auth, ctok)
+
+	ts := httptest.NewServer(auth.TokenHeartbeat(recordingHandler))
+	defer ts.Close()
+
+	resp, err := getWithCookie(ts, ctok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCtok, err := getCookie(resp, defaultCookieName)
+	if err != nil {
+		t.Fatalf("Bad cookie get on heartbeat: %s", err)
+	}
+	secondToken := csrfTokenFor(t, auth, newCtok)
+
+	if firstToken == secondToken {
+		t.Error("expected csrf claim to rotate on TokenHeartbeat refresh")
+	}
+}
+
+func TestServeCSRFToken(t *testing.T) {
+	ts := httptest.NewServer(auth.TokenAuthenticate(http.HandlerFunc(auth.ServeCSRFToken)))
+	defer ts.Close()
+
+	ctok, err := getTestCookie(t, auth)
+	if err != nil {
+		t.Fatalf("Error getting a test cookie: %s", err)
+	}
+	resp, err := getWithCookie(ts, ctok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected http response %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,217 @@
+// Package jwtauth provides cookie-based authentication backed by signed
+// JSON Web Tokens. An Authenticator issues a JWT in a cookie after login,
+// verifies it on subsequent requests, and makes the decoded claim set
+// available to downstream handlers via the request context.
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lestrrat/go-jwx/jwa"
+	"github.com/lestrrat/go-jwx/jwe"
+	"github.com/lestrrat/go-jwx/jws"
+	"github.com/lestrrat/go-jwx/jwt"
+)
+
+const (
+	defaultCookieName     = "auth"
+	defaultCookieLifespan = 24 * time.Hour
+)
+
+type claimSetKey struct{}
+
+// Authenticator issues and verifies JWT cookies signed with the active key
+// of a KeySet.
+type Authenticator struct {
+	keySet        *KeySet
+	encryptionKey []byte
+	longTermStore LongTermStore
+}
+
+// Option configures optional Authenticator behavior at construction time.
+type Option func(*Authenticator)
+
+// WithEncryption wraps every issued JWT in a JWE envelope, content-encrypted
+// with A256GCM under aesKey using direct key agreement, so the claim set is
+// opaque to anyone holding only the cookie. aesKey must be 32 bytes.
+func WithEncryption(aesKey []byte) Option {
+	return func(auth *Authenticator) {
+		auth.encryptionKey = aesKey
+	}
+}
+
+// NewAuthenticator returns an Authenticator that signs tokens with keySet's
+// active key and verifies them against whichever key in the set matches
+// the token's kid.
+func NewAuthenticator(keySet *KeySet, opts ...Option) *Authenticator {
+	auth := &Authenticator{
+		keySet:        keySet,
+		longTermStore: NewMemoryLongTermStore(),
+	}
+	for _, opt := range opts {
+		opt(auth)
+	}
+	return auth
+}
+
+// buildToken stamps cs with a fresh issued/expiry time and CSRF claim,
+// signs it with the KeySet's active key (recording its kid in the JWT
+// header), and wraps it in a JWE envelope when the Authenticator was
+// constructed with WithEncryption. It underlies both EncodeToken, which
+// sets the result as a cookie, and IssueBearer, which returns it directly.
+func (auth *Authenticator) buildToken(cs *jwt.ClaimSet) ([]byte, error) {
+	now := time.Now()
+	cs.IssuedAt = now.Unix()
+	cs.ExpiresAt = now.Add(defaultCookieLifespan).Unix()
+
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.Set(csrfClaim, csrfToken); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(cs)
+	if err != nil {
+		return nil, err
+	}
+
+	key := auth.keySet.Active()
+	hdrs := jws.NewHeaders()
+	if err := hdrs.Set(jws.KeyIDKey, key.Kid); err != nil {
+		return nil, err
+	}
+	signed, err := jws.Sign(payload, key.Alg, key.Private, jws.WithHeaders(hdrs))
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.encryptionKey != nil {
+		return jwe.Encrypt(signed, jwa.DIRECT, auth.encryptionKey, jwa.A256GCM, jwa.NoCompress)
+	}
+	return signed, nil
+}
+
+// EncodeToken signs cs as a JWT and sets it as a cookie on w. See
+// buildToken for what gets stamped into the token.
+func (auth *Authenticator) EncodeToken(w http.ResponseWriter, cs *jwt.ClaimSet) error {
+	token, err := auth.buildToken(cs)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     defaultCookieName,
+		Value:    string(token),
+		Path:     "/",
+		Expires:  time.Unix(cs.ExpiresAt, 0),
+		HttpOnly: true,
+	})
+	return nil
+}
+
+// decodeToken extracts and verifies the JWT carried by r, whether as the
+// defaultCookieName cookie (browser routes) or an "Authorization: Bearer"
+// header (API routes), returning its claim set. If the Authenticator is
+// configured with WithEncryption, the token is first opened as a JWE
+// envelope. The token's kid header picks which key in the KeySet verifies
+// it, so tokens signed before a key rotation still decode during the
+// retired key's grace period.
+func (auth *Authenticator) decodeToken(r *http.Request) (*jwt.ClaimSet, error) {
+	signed, err := tokenFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.encryptionKey != nil {
+		signed, err = jwe.Decrypt(signed, jwa.DIRECT, auth.encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kid, err := kidFromJWS(signed)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := auth.keySet.ByKid(kid)
+	if !ok {
+		return nil, fmt.Errorf("jwtauth: unknown signing key %q", kid)
+	}
+
+	payload, err := jws.Verify(signed, key.Alg, key.Public)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := jwt.Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.Verify(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// ClaimSetFromRequest returns the claim set previously decoded for r by
+// TokenAuthenticate or TokenHeartbeat, and whether one was present.
+func (auth *Authenticator) ClaimSetFromRequest(r *http.Request) (*jwt.ClaimSet, bool) {
+	cs, ok := r.Context().Value(claimSetKey{}).(*jwt.ClaimSet)
+	return cs, ok
+}
+
+// TokenAuthenticate requires a valid JWT, carried in the cookie or an
+// "Authorization: Bearer" header, redirecting to "/" with 303 See Other
+// when one is absent or invalid. On success the decoded
+// claim set is attached to the request context for next.
+func (auth *Authenticator) TokenAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs, err := auth.decodeToken(r)
+		if err != nil {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		ctx := context.WithValue(r.Context(), claimSetKey{}, cs)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// TokenHeartbeat decodes the JWT (cookie or bearer header), re-issues it as
+// a cookie with a refreshed expiry, attaches the claim set to the request context, and calls next.
+// Unlike TokenAuthenticate it does not reject the request on failure; it
+// simply leaves the claim set absent from the context.
+func (auth *Authenticator) TokenHeartbeat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs, err := auth.decodeToken(r)
+		if err == nil {
+			if err := auth.EncodeToken(w, cs); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), claimSetKey{}, cs)
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Logout clears the JWT cookie before calling next.
+func (auth *Authenticator) Logout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     defaultCookieName,
+			Value:    "",
+			Path:     "/",
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,7 +2,6 @@ package jwtauth
 
 import (
 	"crypto/rand"
-	"crypto/rsa"
 	"flag"
 	"fmt"
 	pseudorand "math/rand"
@@ -17,14 +16,23 @@ import (
 )
 
 var auth *Authenticator
+var encAuth *Authenticator
 
 func TestMain(m *testing.M) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey, err := rsaTestKey()
 	if err != nil {
 		fmt.Printf("error generating test RSA key: %s", err)
 		os.Exit(1)
 	}
-	auth = NewAuthenticator(privateKey)
+	keySet := NewKeySet(RS256Key("test-key", privateKey))
+	auth = NewAuthenticator(keySet)
+
+	aesKey := make([]byte, 32)
+	if _, err := rand.Read(aesKey); err != nil {
+		fmt.Printf("error generating test AES key: %s", err)
+		os.Exit(1)
+	}
+	encAuth = NewAuthenticator(keySet, WithEncryption(aesKey))
 
 	flag.Parse()
 	os.Exit(m.Run())
@@ -78,8 +86,8 @@ func getCookie(r *http.Response, name string) (*http.Cookie, error) {
 	return nil, fmt.Errorf("No cookie %s found", name)
 }
 
-func getTestCookie(t *testing.T) (*http.Cookie, error) {
-	ts := httptest.NewServer(http.HandlerFunc(auth.testCookieHandler))
+func getTestCookie(t *testing.T, a *Authenticator) (*http.Cookie, error) {
+	ts := httptest.NewServer(http.HandlerFunc(a.testCookieHandler))
 	defer ts.Close()
 	// Subpath to test that cookie path correctly ends up /
 	resp, err := http.Get(ts.URL + "/sub/path")
@@ -122,7 +130,7 @@ func verifyClaimSet(t *testing.T, cs *jwt.ClaimSet) {
 
 func TestEncodeDecode(t *testing.T) {
 	// Test encode/issue
-	ctok, err := getTestCookie(t)
+	ctok, err := getTestCookie(t, auth)
 	if err != nil {
 		t.Errorf("Failed to get test cookie: %s", err)
 	}
@@ -141,6 +149,30 @@ func TestEncodeDecode(t *testing.T) {
 	verifyClaimSet(t, ncs)
 }
 
+func TestEncodeDecodeEncrypted(t *testing.T) {
+	ctok, err := getTestCookie(t, encAuth)
+	if err != nil {
+		t.Errorf("Failed to get encrypted test cookie: %s", err)
+	}
+	verifyTestCookie(t, ctok)
+
+	chunks := strings.SplitN(ctok.Value, ".", 5)
+	if len(chunks) != 5 {
+		t.Errorf("JWE had wrong number of segments, expected 5 got %d", len(chunks))
+	}
+
+	req, err := http.NewRequest("GET", "/random", nil)
+	if err != nil {
+		t.Errorf("Unable to create http request: %s", err)
+	}
+	req.AddCookie(ctok)
+	ncs, err := encAuth.decodeToken(req)
+	if err != nil {
+		t.Errorf("Encrypted token decode failed: %s", err)
+	}
+	verifyClaimSet(t, ncs)
+}
+
 func getWithCookie(ts *httptest.Server, c *http.Cookie) (*http.Response, error) {
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -154,7 +186,7 @@ func getWithCookie(ts *httptest.Server, c *http.Cookie) (*http.Response, error)
 }
 
 func TestHeartbeat(t *testing.T) {
-	ctok, err := getTestCookie(t)
+	ctok, err := getTestCookie(t, auth)
 	if err != nil {
 		t.Errorf("Error getting a test cookie: %s", err)
 	}
@@ -192,7 +224,7 @@ func TestHeartbeat(t *testing.T) {
 }
 
 func TestLogout(t *testing.T) {
-	ctok, err := getTestCookie(t)
+	ctok, err := getTestCookie(t, auth)
 	if err != nil {
 		t.Errorf("Error getting a test cookie: %s", err)
 	}
@@ -240,7 +272,7 @@ func TestCorruptCookie(t *testing.T) {
 	ts := httptest.NewServer(auth.TokenAuthenticate(recordingHandler))
 	defer ts.Close()
 
-	cook, err := getTestCookie(t)
+	cook, err := getTestCookie(t, auth)
 	if err != nil {
 		t.Errorf("Error getting a test cookie: %s", err)
 	}
@@ -254,7 +286,7 @@ func TestCorruptCookie(t *testing.T) {
 	badsig := fmt.Sprintf("%s.%s.%s", chunks[0], chunks[1], corrupt(chunks[2]))
 	cook.Value = badsig
 
-	resp, err := getWithCookie(ts, &http.Cookie{})
+	resp, err := getWithCookie(ts, cook)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -264,6 +296,44 @@ func TestCorruptCookie(t *testing.T) {
 	}
 }
 
+func TestCorruptEncryptedCookie(t *testing.T) {
+	ts := httptest.NewServer(encAuth.TokenAuthenticate(recordingHandler))
+	defer ts.Close()
+
+	goodCook, err := getTestCookie(t, encAuth)
+	if err != nil {
+		t.Errorf("Error getting an encrypted test cookie: %s", err)
+	}
+
+	chunks := strings.SplitN(goodCook.Value, ".", 5)
+	if len(chunks) != 5 {
+		t.Errorf("JWE had wrong number of segments, expected 5 got %d", len(chunks))
+	}
+
+	// Tampering any one of the five JWE segments (header, encrypted key,
+	// IV, ciphertext, or auth tag) must reject the cookie. With jwa.DIRECT
+	// key agreement the encrypted-key segment is empty per RFC 7516, so
+	// there's nothing to flip a bit in there; skip it.
+	for i := range chunks {
+		if chunks[i] == "" {
+			continue
+		}
+		tampered := make([]string, len(chunks))
+		copy(tampered, chunks)
+		tampered[i] = corrupt(tampered[i])
+		cook := &http.Cookie{Name: defaultCookieName, Value: strings.Join(tampered, ".")}
+
+		resp, err := getWithCookie(ts, cook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Errorf("Authentication fail (bad segment %d) didn't redirect, expected %d, got %d",
+				i, http.StatusSeeOther, resp.StatusCode)
+		}
+	}
+}
+
 // Make sure we don't succeed or cause a panic trying to fetch a ClaimSet
 // from a request which lacks one
 func TestSafeCSGet(t *testing.T) {
@@ -0,0 +1,215 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat/go-jwx/jwa"
+	"github.com/lestrrat/go-jwx/jws"
+)
+
+// defaultKeyGracePeriod is how long a key retired by Rotate stays valid
+// for verification, so cookies signed moments before a rotation don't
+// suddenly fail to decode.
+const defaultKeyGracePeriod = 24 * time.Hour
+
+// Key is a single named signing key. Private is whatever jws.Sign expects
+// for Alg (a *rsa.PrivateKey for RS256, a *ecdsa.PrivateKey for ES256, or a
+// []byte secret for HS256); Public is the matching value jws.Verify
+// expects, which for HS256 is the same secret.
+type Key struct {
+	Kid     string
+	Alg     jwa.SignatureAlgorithm
+	Private interface{}
+	Public  interface{}
+}
+
+// RS256Key builds a Key for RSA-signed (RS256) tokens.
+func RS256Key(kid string, key *rsa.PrivateKey) *Key {
+	return &Key{Kid: kid, Alg: jwa.RS256, Private: key, Public: &key.PublicKey}
+}
+
+// ES256Key builds a Key for ECDSA-signed (ES256) tokens.
+func ES256Key(kid string, key *ecdsa.PrivateKey) *Key {
+	return &Key{Kid: kid, Alg: jwa.ES256, Private: key, Public: &key.PublicKey}
+}
+
+// HS256Key builds a Key for HMAC-signed (HS256) tokens. secret is used for
+// both signing and verification and is never published via ServeJWKS.
+func HS256Key(kid string, secret []byte) *Key {
+	return &Key{Kid: kid, Alg: jwa.HS256, Private: secret, Public: secret}
+}
+
+type retiredKey struct {
+	key        *Key
+	validUntil time.Time
+}
+
+// KeySet holds the signing key an Authenticator currently issues tokens
+// with plus any keys Rotate has since retired but which remain valid for
+// verification during their grace period. EncodeToken signs with Active
+// and stamps its Kid in the JWT header; decodeToken looks the token's kid
+// up across the whole set with ByKid so tokens issued before a rotation
+// keep verifying.
+type KeySet struct {
+	mu      sync.RWMutex
+	active  *Key
+	retired []retiredKey
+}
+
+// NewKeySet returns a KeySet whose active signing key is active.
+func NewKeySet(active *Key) *KeySet {
+	return &KeySet{active: active}
+}
+
+// Active returns the key currently used to sign new tokens.
+func (ks *KeySet) Active() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+// ByKid returns the key with the given kid, whether it's the active key or
+// one retired by Rotate that's still within its grace period.
+func (ks *KeySet) ByKid(kid string) (*Key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.active != nil && ks.active.Kid == kid {
+		return ks.active, true
+	}
+	now := time.Now()
+	for _, r := range ks.retired {
+		if r.key.Kid == kid && now.Before(r.validUntil) {
+			return r.key, true
+		}
+	}
+	return nil, false
+}
+
+// Rotate makes newKey the active signing key. The previously active key is
+// retired but stays valid for verification until gracePeriod elapses.
+func (ks *KeySet) Rotate(newKey *Key, gracePeriod time.Duration) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.active != nil {
+		ks.retired = append(ks.retired, retiredKey{key: ks.active, validUntil: time.Now().Add(gracePeriod)})
+	}
+	ks.active = newKey
+}
+
+// liveKeys returns every key (active plus still-in-grace retired keys)
+// currently valid for verification.
+func (ks *KeySet) liveKeys() []*Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	keys := make([]*Key, 0, len(ks.retired)+1)
+	if ks.active != nil {
+		keys = append(keys, ks.active)
+	}
+	now := time.Now()
+	for _, r := range ks.retired {
+		if now.Before(r.validUntil) {
+			keys = append(keys, r.key)
+		}
+	}
+	return keys
+}
+
+// Rotate retires the current active signing key, keeping it valid for
+// verification until its grace period ends, and makes newKey active.
+func (auth *Authenticator) Rotate(newKey *Key) {
+	auth.keySet.Rotate(newKey, defaultKeyGracePeriod)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type jwksDoc struct {
+	Keys []jwk `json:"keys"`
+}
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// publicJWK renders the public half of key as a JWK, or ok=false for
+// symmetric (HS256) keys, which have no public half to publish.
+func publicJWK(key *Key) (jwk, bool) {
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		return jwk{
+			Kty: "RSA",
+			Kid: key.Kid,
+			Use: "sig",
+			Alg: key.Alg.String(),
+			N:   b64url(pub.N.Bytes()),
+			E:   b64url(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return jwk{
+			Kty: "EC",
+			Kid: key.Kid,
+			Use: "sig",
+			Alg: key.Alg.String(),
+			Crv: pub.Curve.Params().Name,
+			X:   b64url(pub.X.FillBytes(make([]byte, size))),
+			Y:   b64url(pub.Y.FillBytes(make([]byte, size))),
+		}, true
+	default:
+		return jwk{}, false
+	}
+}
+
+// ServeJWKS publishes the public half of every live key in the
+// Authenticator's KeySet as a JSON Web Key Set, so downstream services can
+// verify tokens without sharing the private signing key. Symmetric
+// (HS256) keys are never published.
+func (auth *Authenticator) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	doc := jwksDoc{Keys: []jwk{}}
+	for _, key := range auth.keySet.liveKeys() {
+		if k, ok := publicJWK(key); ok {
+			doc.Keys = append(doc.Keys, k)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// kidFromJWS reads the kid header from a signed (JWS) token, after any JWE
+// envelope has already been removed, without verifying its signature, so
+// decodeToken can look up the right key before calling jws.Verify.
+func kidFromJWS(token []byte) (string, error) {
+	msg, err := jws.Parse(token)
+	if err != nil {
+		return "", err
+	}
+	sigs := msg.Signatures()
+	if len(sigs) == 0 {
+		return "", errors.New("jwtauth: token carries no signatures")
+	}
+	kid := sigs[0].ProtectedHeaders().KeyID()
+	if kid == "" {
+		return "", fmt.Errorf("jwtauth: token header has no kid")
+	}
+	return kid, nil
+}
@@ -0,0 +1,79 @@
+package jwtauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRotateKeepsOldTokenVerifiableDuringGrace(t *testing.T) {
+	oldKey, err := rsaTestKey()
+	if err != nil {
+		t.Fatalf("error generating test RSA key: %s", err)
+	}
+	newKey, err := rsaTestKey()
+	if err != nil {
+		t.Fatalf("error generating test RSA key: %s", err)
+	}
+
+	keySet := NewKeySet(RS256Key("old", oldKey))
+	a := NewAuthenticator(keySet)
+
+	ctok, err := getTestCookie(t, a)
+	if err != nil {
+		t.Fatalf("Failed to get test cookie: %s", err)
+	}
+
+	a.Rotate(RS256Key("new", newKey))
+
+	req, _ := http.NewRequest("GET", "/random", nil)
+	req.AddCookie(ctok)
+	if _, err := a.decodeToken(req); err != nil {
+		t.Errorf("token signed under retired key failed to decode during grace period: %s", err)
+	}
+
+	newCtok, err := getTestCookie(t, a)
+	if err != nil {
+		t.Fatalf("Failed to get test cookie after rotation: %s", err)
+	}
+	newReq, _ := http.NewRequest("GET", "/random", nil)
+	newReq.AddCookie(newCtok)
+	if _, err := a.decodeToken(newReq); err != nil {
+		t.Errorf("token signed under new active key failed to decode: %s", err)
+	}
+}
+
+func TestServeJWKSPublishesActiveAndRetiredKeys(t *testing.T) {
+	oldKey, err := rsaTestKey()
+	if err != nil {
+		t.Fatalf("error generating test RSA key: %s", err)
+	}
+	newKey, err := rsaTestKey()
+	if err != nil {
+		t.Fatalf("error generating test RSA key: %s", err)
+	}
+
+	keySet := NewKeySet(RS256Key("old", oldKey))
+	a := NewAuthenticator(keySet)
+	a.Rotate(RS256Key("new", newKey))
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	a.ServeJWKS(rec, req)
+
+	var doc jwksDoc
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("ServeJWKS did not return valid JSON: %s", err)
+	}
+	if len(doc.Keys) != 2 {
+		t.Fatalf("expected 2 published keys, got %d", len(doc.Keys))
+	}
+	kids := map[string]bool{}
+	for _, k := range doc.Keys {
+		kids[k.Kid] = true
+	}
+	if !kids["old"] || !kids["new"] {
+		t.Errorf("expected both old and new kids published, got %v", kids)
+	}
+}
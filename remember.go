@@ -0,0 +1,294 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat/go-jwx/jwt"
+)
+
+const (
+	rememberCookieName    = "remember"
+	rememberTokenLifespan = 30 * 24 * time.Hour
+	selectorBytes         = 16
+	verifierBytes         = 32
+)
+
+// ErrUnknownSelector is returned by a LongTermStore when no row matches the
+// requested selector, typically because it never existed or has expired.
+var ErrUnknownSelector = errors.New("jwtauth: unknown selector")
+
+// LongTermToken is a single stored remember-me credential. Verifier is
+// never stored in the clear; only VerifierHash, the SHA-256 of it, is
+// persisted.
+type LongTermToken struct {
+	Selector     string
+	VerifierHash []byte
+	Subject      string
+	ExpiresAt    time.Time
+}
+
+// LongTermStore persists remember-me tokens keyed by selector so that
+// RememberMe can look one up in O(1) and verify it without ever comparing
+// the raw verifier to stored state. Implementations should back this with
+// whatever the application already uses for durable storage (SQL, Redis,
+// etc.); MemoryLongTermStore is a default suitable for tests and
+// single-process deployments.
+type LongTermStore interface {
+	// Get returns the token stored under selector, or ErrUnknownSelector
+	// if none exists.
+	Get(selector string) (*LongTermToken, error)
+	// Put stores tok, replacing any existing row with the same selector.
+	Put(tok *LongTermToken) error
+	// Delete removes the row for selector, if any.
+	Delete(selector string) error
+	// DeleteBySubject removes every row belonging to subject, used to log
+	// a user out of all long-term sessions at once.
+	DeleteBySubject(subject string) error
+	// Sweep removes every row that expired before now.
+	Sweep(now time.Time) error
+}
+
+// MemoryLongTermStore is an in-memory LongTermStore. It is the default used
+// by NewAuthenticator when no other store is configured.
+type MemoryLongTermStore struct {
+	mu     sync.Mutex
+	tokens map[string]*LongTermToken
+}
+
+// NewMemoryLongTermStore returns an empty MemoryLongTermStore.
+func NewMemoryLongTermStore() *MemoryLongTermStore {
+	return &MemoryLongTermStore{tokens: make(map[string]*LongTermToken)}
+}
+
+// Get implements LongTermStore.
+func (s *MemoryLongTermStore) Get(selector string) (*LongTermToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, ok := s.tokens[selector]
+	if !ok {
+		return nil, ErrUnknownSelector
+	}
+	return tok, nil
+}
+
+// Put implements LongTermStore.
+func (s *MemoryLongTermStore) Put(tok *LongTermToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[tok.Selector] = tok
+	return nil
+}
+
+// Delete implements LongTermStore.
+func (s *MemoryLongTermStore) Delete(selector string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, selector)
+	return nil
+}
+
+// DeleteBySubject implements LongTermStore.
+func (s *MemoryLongTermStore) DeleteBySubject(subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sel, tok := range s.tokens {
+		if tok.Subject == subject {
+			delete(s.tokens, sel)
+		}
+	}
+	return nil
+}
+
+// Sweep implements LongTermStore.
+func (s *MemoryLongTermStore) Sweep(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sel, tok := range s.tokens {
+		if tok.ExpiresAt.Before(now) {
+			delete(s.tokens, sel)
+		}
+	}
+	return nil
+}
+
+// WithLongTermStore configures the LongTermStore backing RememberMe and
+// LogoutAll. When not supplied, NewAuthenticator uses a fresh
+// MemoryLongTermStore.
+func WithLongTermStore(store LongTermStore) Option {
+	return func(auth *Authenticator) {
+		auth.longTermStore = store
+	}
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func verifierHash(verifier []byte) []byte {
+	sum := sha256.Sum256(verifier)
+	return sum[:]
+}
+
+// issueLongTermPair generates a fresh selector/verifier pair for subject,
+// stores it, and returns the cookie value to hand to the browser.
+func (auth *Authenticator) issueLongTermPair(subject string) (string, error) {
+	selector, err := randomBytes(selectorBytes)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomBytes(verifierBytes)
+	if err != nil {
+		return "", err
+	}
+
+	selectorStr := base64.RawURLEncoding.EncodeToString(selector)
+	tok := &LongTermToken{
+		Selector:     selectorStr,
+		VerifierHash: verifierHash(verifier),
+		Subject:      subject,
+		ExpiresAt:    time.Now().Add(rememberTokenLifespan),
+	}
+	if err := auth.longTermStore.Put(tok); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s:%s", selectorStr, base64.RawURLEncoding.EncodeToString(verifier)), nil
+}
+
+// IssueLongTerm sets a long-term "remember me" cookie for subject,
+// independent of and in addition to the short-lived JWT cookie.
+func (auth *Authenticator) IssueLongTerm(w http.ResponseWriter, subject string) error {
+	value, err := auth.issueLongTermPair(subject)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     rememberCookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  time.Now().Add(rememberTokenLifespan),
+		HttpOnly: true,
+	})
+	return nil
+}
+
+// verifyLongTerm looks up and validates the remember-me cookie on r,
+// returning the subject it was issued for and the selector it was found
+// under (so the caller can retire that row when rotating).
+func (auth *Authenticator) verifyLongTerm(r *http.Request) (subject, selector string, err error) {
+	cook, err := r.Cookie(rememberCookieName)
+	if err != nil {
+		return "", "", err
+	}
+
+	selector, verifierEnc, ok := splitSelectorVerifier(cook.Value)
+	if !ok {
+		return "", "", errors.New("jwtauth: malformed remember-me cookie")
+	}
+	verifier, err := base64.RawURLEncoding.Strict().DecodeString(verifierEnc)
+	if err != nil {
+		return "", "", errors.New("jwtauth: malformed remember-me cookie")
+	}
+
+	tok, err := auth.longTermStore.Get(selector)
+	if err != nil {
+		return "", "", err
+	}
+	if time.Now().After(tok.ExpiresAt) {
+		auth.longTermStore.Delete(selector)
+		return "", "", ErrUnknownSelector
+	}
+	if subtle.ConstantTimeCompare(verifierHash(verifier), tok.VerifierHash) != 1 {
+		return "", "", errors.New("jwtauth: verifier mismatch")
+	}
+	return tok.Subject, selector, nil
+}
+
+func splitSelectorVerifier(value string) (selector, verifier string, ok bool) {
+	for i := 0; i < len(value); i++ {
+		if value[i] == ':' {
+			return value[:i], value[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// RememberMe wraps next so that when the JWT cookie is absent or invalid
+// but a valid long-term cookie is present, the long-term token is rotated
+// (the old row is deleted and a new selector/verifier pair issued) and a
+// fresh short-lived JWT cookie is issued for the same subject before next
+// runs. It never rejects a request; if neither cookie validates, next just
+// runs without a claim set in the context.
+func (auth *Authenticator) RememberMe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := auth.decodeToken(r); err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		subject, oldSelector, err := auth.verifyLongTerm(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth.longTermStore.Delete(oldSelector)
+
+		if err := auth.IssueLongTerm(w, subject); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		cs := jwt.NewClaimSet()
+		if err := cs.Set("sub", subject); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := auth.EncodeToken(w, cs); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), claimSetKey{}, cs)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LogoutAll invalidates every stored long-term token for subject, so a
+// database dump or leaked cookie can't be replayed after the user signs
+// out everywhere.
+func (auth *Authenticator) LogoutAll(subject string) error {
+	return auth.longTermStore.DeleteBySubject(subject)
+}
+
+// SweepLongTermStore starts a goroutine that periodically removes expired
+// rows from the configured LongTermStore. Callers own its lifecycle: call
+// the returned stop function to halt the sweeper.
+func (auth *Authenticator) SweepLongTermStore(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				auth.longTermStore.Sweep(time.Now())
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
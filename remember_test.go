@@ -0,0 +1,152 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func rsaTestKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+func testKeySet(t *testing.T) *KeySet {
+	t.Helper()
+	key, err := rsaTestKey()
+	if err != nil {
+		t.Fatalf("error generating test RSA key: %s", err)
+	}
+	return NewKeySet(RS256Key("test-key", key))
+}
+
+func TestIssueAndVerifyLongTerm(t *testing.T) {
+	store := NewMemoryLongTermStore()
+	a := NewAuthenticator(testKeySet(t), WithLongTermStore(store))
+
+	rec := httptest.NewRecorder()
+	if err := a.IssueLongTerm(rec, testData["sub"]); err != nil {
+		t.Fatalf("IssueLongTerm failed: %s", err)
+	}
+	cook, err := getCookie(rec.Result(), rememberCookieName)
+	if err != nil {
+		t.Fatalf("no remember-me cookie set: %s", err)
+	}
+	if !strings.Contains(cook.Value, ":") {
+		t.Errorf("expected selector:verifier cookie value, got %q", cook.Value)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.AddCookie(cook)
+	subject, selector, err := a.verifyLongTerm(req)
+	if err != nil {
+		t.Fatalf("verifyLongTerm failed: %s", err)
+	}
+	if subject != testData["sub"] {
+		t.Errorf("expected subject %s got %s", testData["sub"], subject)
+	}
+	if _, err := store.Get(selector); err != nil {
+		t.Errorf("expected row for selector to still exist: %s", err)
+	}
+}
+
+func TestVerifyLongTermRejectsTamperedVerifier(t *testing.T) {
+	store := NewMemoryLongTermStore()
+	a := NewAuthenticator(testKeySet(t), WithLongTermStore(store))
+
+	rec := httptest.NewRecorder()
+	if err := a.IssueLongTerm(rec, testData["sub"]); err != nil {
+		t.Fatalf("IssueLongTerm failed: %s", err)
+	}
+	cook, err := getCookie(rec.Result(), rememberCookieName)
+	if err != nil {
+		t.Fatalf("no remember-me cookie set: %s", err)
+	}
+	cook.Value = corrupt(cook.Value)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.AddCookie(cook)
+	if _, _, err := a.verifyLongTerm(req); err == nil {
+		t.Error("expected tampered verifier to be rejected")
+	}
+}
+
+func TestRememberMeRotatesAndReissuesJWT(t *testing.T) {
+	store := NewMemoryLongTermStore()
+	a := NewAuthenticator(testKeySet(t), WithLongTermStore(store))
+
+	rec := httptest.NewRecorder()
+	if err := a.IssueLongTerm(rec, testData["sub"]); err != nil {
+		t.Fatalf("IssueLongTerm failed: %s", err)
+	}
+	firstCook, err := getCookie(rec.Result(), rememberCookieName)
+	if err != nil {
+		t.Fatalf("no remember-me cookie set: %s", err)
+	}
+	firstSelector, _, _ := splitSelectorVerifier(firstCook.Value)
+
+	recordingHandler.Called = false
+	recordingHandler.ClaimSet = nil
+	ts := httptest.NewServer(a.RememberMe(recordingHandler))
+	defer ts.Close()
+
+	resp, err := getWithCookie(ts, firstCook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getCookie(resp, defaultCookieName); err != nil {
+		t.Errorf("RememberMe did not re-issue a JWT cookie: %s", err)
+	}
+	newRemember, err := getCookie(resp, rememberCookieName)
+	if err != nil {
+		t.Fatalf("RememberMe did not rotate the long-term cookie: %s", err)
+	}
+	newSelector, _, _ := splitSelectorVerifier(newRemember.Value)
+	if newSelector == firstSelector {
+		t.Error("expected selector to rotate on use")
+	}
+
+	if !recordingHandler.Called {
+		t.Error("RememberMe didn't pass through to next handler")
+	}
+	if recordingHandler.ClaimSet == nil || recordingHandler.ClaimSet.Get("sub") != testData["sub"] {
+		t.Error("RememberMe didn't attach the reissued claim set to the request context")
+	}
+	if _, err := store.Get(firstSelector); err != ErrUnknownSelector {
+		t.Error("expected old selector to be deleted after rotation")
+	}
+}
+
+func TestLogoutAllRemovesEverySubjectToken(t *testing.T) {
+	store := NewMemoryLongTermStore()
+	a := NewAuthenticator(testKeySet(t), WithLongTermStore(store))
+
+	rec1, rec2 := httptest.NewRecorder(), httptest.NewRecorder()
+	if err := a.IssueLongTerm(rec1, "user@example.com"); err != nil {
+		t.Fatalf("IssueLongTerm failed: %s", err)
+	}
+	if err := a.IssueLongTerm(rec2, "user@example.com"); err != nil {
+		t.Fatalf("IssueLongTerm failed: %s", err)
+	}
+
+	if err := a.LogoutAll("user@example.com"); err != nil {
+		t.Fatalf("LogoutAll failed: %s", err)
+	}
+
+	cook1, _ := getCookie(rec1.Result(), rememberCookieName)
+	cook2, _ := getCookie(rec2.Result(), rememberCookieName)
+	req1, _ := http.NewRequest("GET", "/", nil)
+	req1.AddCookie(cook1)
+	req2, _ := http.NewRequest("GET", "/", nil)
+	req2.AddCookie(cook2)
+
+	if _, _, err := a.verifyLongTerm(req1); err == nil {
+		t.Error("expected first token to be invalidated by LogoutAll")
+	}
+	if _, _, err := a.verifyLongTerm(req2); err == nil {
+		t.Error("expected second token to be invalidated by LogoutAll")
+	}
+}